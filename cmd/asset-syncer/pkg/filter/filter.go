@@ -0,0 +1,130 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package filter implements the asset-syncer's sync-time admission rules:
+// repeatable --filter-name and --filter-annotation flags that decide whether
+// a chart version found in an upstream repo is persisted.
+package filter
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/models"
+)
+
+// AnnotationRule is a single --filter-annotation admission rule. A key-only
+// rule (HasValue false) only requires the annotation key to be present;
+// otherwise the annotation's value must match Value exactly, even when Value
+// is empty (--filter-annotation=key=).
+type AnnotationRule struct {
+	Key   string
+	Value string
+	// HasValue is false for key-only rules (--filter-annotation=key).
+	HasValue bool
+}
+
+// Spec is the effective set of filters applied to a single repo sync, built
+// from the repeatable --filter-name and --filter-annotation flags.
+type Spec struct {
+	// NameGlobs are shell-style glob patterns matched against Chart.Name.
+	NameGlobs []string `json:"nameGlobs,omitempty"`
+	// Annotations are matched against Chart.Annotations.
+	Annotations []AnnotationRule `json:"annotations,omitempty"`
+}
+
+// NameFlags implements flag.Value so --filter-name can be repeated on the
+// command line, accumulating one glob pattern per occurrence.
+type NameFlags []string
+
+func (f *NameFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set appends the given glob pattern, validating it compiles.
+func (f *NameFlags) Set(value string) error {
+	if _, err := filepath.Match(value, ""); err != nil {
+		return fmt.Errorf("invalid --filter-name pattern %q: %w", value, err)
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+// AnnotationFlags implements flag.Value so --filter-annotation can be
+// repeated, accepting either `key` or `key=value` form.
+type AnnotationFlags []AnnotationRule
+
+func (f *AnnotationFlags) String() string {
+	parts := make([]string, len(*f))
+	for i, r := range *f {
+		if r.HasValue {
+			parts[i] = r.Key + "=" + r.Value
+		} else {
+			parts[i] = r.Key
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set parses a single --filter-annotation occurrence.
+func (f *AnnotationFlags) Set(value string) error {
+	key, val, hasValue := strings.Cut(value, "=")
+	if key == "" {
+		return fmt.Errorf("invalid --filter-annotation %q: key must not be empty", value)
+	}
+	*f = append(*f, AnnotationRule{Key: key, Value: val, HasValue: hasValue})
+	return nil
+}
+
+// NewSpec builds a Spec from the accumulated flag values.
+func NewSpec(names NameFlags, annotations AnnotationFlags) Spec {
+	return Spec{NameGlobs: names, Annotations: annotations}
+}
+
+// Admits reports whether a chart version should be persisted: its chart name
+// must match at least one name glob (when any are configured), and every
+// configured annotation rule must be satisfied.
+func (s Spec) Admits(chart models.Chart) bool {
+	if len(s.NameGlobs) > 0 && !s.matchesAnyName(chart.Name) {
+		return false
+	}
+	for _, rule := range s.Annotations {
+		value, ok := chart.Annotations[rule.Key]
+		if !ok {
+			return false
+		}
+		if rule.HasValue && value != rule.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// SaveSpec persists the effective Spec applied to a repo sync into the
+// repo_filters table, so assetsvc's GET .../repos/{repo}/filter endpoint can
+// report back the filters that were in effect the last time the repo was
+// synced. Call it once per repo sync, after building spec with NewSpec.
+func (s Spec) SaveSpec(db *sql.DB, namespace, repoName string) error {
+	specJSON, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(
+		"INSERT INTO repo_filters (namespace, repo_name, filter) VALUES ($1, $2, $3) "+
+			"ON CONFLICT (namespace, repo_name) DO UPDATE SET filter = excluded.filter",
+		namespace, repoName, specJSON,
+	)
+	return err
+}
+
+func (s Spec) matchesAnyName(name string) bool {
+	for _, pattern := range s.NameGlobs {
+		if ok, err := filepath.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
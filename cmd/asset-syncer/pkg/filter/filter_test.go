@@ -0,0 +1,104 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/models"
+)
+
+func Test_SpecAdmits(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   Spec
+		chart  models.Chart
+		admits bool
+	}{
+		{
+			"no filters admits everything",
+			Spec{},
+			models.Chart{Name: "wordpress"},
+			true,
+		},
+		{
+			"name glob matches",
+			Spec{NameGlobs: []string{"word*"}},
+			models.Chart{Name: "wordpress"},
+			true,
+		},
+		{
+			"name glob does not match",
+			Spec{NameGlobs: []string{"mysql*"}},
+			models.Chart{Name: "wordpress"},
+			false,
+		},
+		{
+			"key-only annotation present",
+			Spec{Annotations: []AnnotationRule{{Key: "certified"}}},
+			models.Chart{Name: "wordpress", Annotations: map[string]string{"certified": "true"}},
+			true,
+		},
+		{
+			"key-only annotation missing",
+			Spec{Annotations: []AnnotationRule{{Key: "certified"}}},
+			models.Chart{Name: "wordpress"},
+			false,
+		},
+		{
+			"key=value annotation matches",
+			Spec{Annotations: []AnnotationRule{{Key: "team", Value: "platform", HasValue: true}}},
+			models.Chart{Name: "wordpress", Annotations: map[string]string{"team": "platform"}},
+			true,
+		},
+		{
+			"key=value annotation mismatches",
+			Spec{Annotations: []AnnotationRule{{Key: "team", Value: "platform", HasValue: true}}},
+			models.Chart{Name: "wordpress", Annotations: map[string]string{"team": "data"}},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.admits, tt.spec.Admits(tt.chart))
+		})
+	}
+}
+
+func Test_NameFlagsSet(t *testing.T) {
+	var names NameFlags
+	assert.NoError(t, names.Set("word*"))
+	assert.NoError(t, names.Set("my-*"))
+	assert.Equal(t, NameFlags{"word*", "my-*"}, names)
+
+	var bad NameFlags
+	assert.Error(t, bad.Set("["))
+}
+
+func Test_AnnotationFlagsSet(t *testing.T) {
+	var annotations AnnotationFlags
+	assert.NoError(t, annotations.Set("certified"))
+	assert.NoError(t, annotations.Set("team=platform"))
+	assert.Equal(t, AnnotationFlags{
+		{Key: "certified"},
+		{Key: "team", Value: "platform", HasValue: true},
+	}, annotations)
+}
+
+func Test_SpecSaveSpec(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	spec := Spec{NameGlobs: []string{"word*"}, Annotations: []AnnotationRule{{Key: "certified"}}}
+	mock.ExpectExec("INSERT INTO repo_filters").
+		WithArgs("my-namespace", "my-repo", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	assert.NoError(t, spec.SaveSpec(db, "my-namespace", "my-repo"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,63 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sync discovers and normalizes chart versions from an upstream
+// repository ahead of insertion into the `charts`/`files` tables that back
+// assetsvc, regardless of whether the repo is a classic Helm HTTP index or
+// an OCI registry.
+package sync
+
+import (
+	"fmt"
+
+	"github.com/vmware-tanzu/kubeapps/cmd/asset-syncer/pkg/filter"
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/models"
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/oci"
+)
+
+// OCIRepo identifies an OCI-backed Helm chart repository, as configured on
+// the repo custom resource.
+type OCIRepo struct {
+	Registry string
+	RepoName string
+	Repo     models.Repo
+	Auth     oci.Auth
+}
+
+// SyncedChart pairs a chart's metadata with its auxiliary files, ready to be
+// persisted into the `charts` and `files` tables.
+type SyncedChart struct {
+	Chart models.Chart
+	Files models.ChartFiles
+}
+
+// SyncOCIRepo lists every tag published for an OCI repo, pulls each chart
+// version's manifest and content layer, and applies the given filter.Spec
+// (admit by name/annotation) before returning the admitted charts -- so that
+// charts discovered this way populate the same tables, and are therefore
+// served identically, as ones synced from a classic index.yaml repo.
+func SyncOCIRepo(client *oci.Client, repo OCIRepo, spec filter.Spec) ([]SyncedChart, error) {
+	tags, err := client.ListTags(repo.RepoName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tags for %s: %w", repo.RepoName, err)
+	}
+
+	synced := make([]SyncedChart, 0, len(tags))
+	for _, tag := range tags {
+		chart, files, err := client.FetchChart(repo.RepoName, tag)
+		if err != nil {
+			// A single bad tag shouldn't fail the whole repo sync; skip it.
+			continue
+		}
+		chart.Repo = repo.Repo
+		chart.ID = repo.Repo.Name + "/" + chart.Name
+		files.Repo = repo.Repo
+		files.ID = chart.ID + "-" + tag
+
+		if !spec.Admits(chart) {
+			continue
+		}
+		synced = append(synced, SyncedChart{Chart: chart, Files: files})
+	}
+	return synced, nil
+}
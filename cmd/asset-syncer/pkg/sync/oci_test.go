@@ -0,0 +1,102 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+package sync
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmware-tanzu/kubeapps/cmd/asset-syncer/pkg/filter"
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/models"
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/oci"
+)
+
+func chartLayer(t *testing.T, name string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	content := "name: " + name + "\n"
+	hdr := &tar.Header{Name: name + "/Chart.yaml", Size: int64(len(content)), Mode: 0600}
+	assert.NoError(t, tw.WriteHeader(hdr))
+	_, err := tw.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func Test_SyncOCIRepo(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/bitnami/wordpress/tags/list", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"1.0.0", "1.1.0"}})
+	})
+	for _, tag := range []string{"1.0.0", "1.1.0"} {
+		digest := "sha256:" + tag
+		mux.HandleFunc("/v2/bitnami/wordpress/manifests/"+tag, func(w http.ResponseWriter, r *http.Request) {
+			parts := strings.Split(r.URL.Path, "/")
+			tag := parts[len(parts)-1]
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"config": map[string]string{"mediaType": "application/vnd.cncf.helm.chart.v1+json"},
+				"layers": []map[string]string{{
+					"mediaType": "application/vnd.cncf.helm.chart.content.v1.tar+gzip",
+					"digest":    "sha256:" + tag,
+				}},
+			})
+		})
+		mux.HandleFunc("/v2/bitnami/wordpress/blobs/"+digest, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(chartLayer(t, "wordpress"))
+		})
+	}
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := oci.NewClient(ts.URL, oci.Auth{})
+	repo := OCIRepo{RepoName: "bitnami/wordpress", Repo: models.Repo{Name: "bitnami", Type: "oci"}}
+
+	synced, err := SyncOCIRepo(client, repo, filter.Spec{})
+	assert.NoError(t, err)
+	assert.Len(t, synced, 2)
+	for _, s := range synced {
+		assert.Equal(t, "bitnami/wordpress", s.Chart.ID)
+		assert.Equal(t, "oci", s.Chart.Repo.Type)
+	}
+}
+
+func Test_SyncOCIRepo_FiltersByName(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/bitnami/wordpress/tags/list", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"1.0.0"}})
+	})
+	mux.HandleFunc("/v2/bitnami/wordpress/manifests/1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"config": map[string]string{"mediaType": "application/vnd.cncf.helm.chart.v1+json"},
+			"layers": []map[string]string{{
+				"mediaType": "application/vnd.cncf.helm.chart.content.v1.tar+gzip",
+				"digest":    "sha256:1.0.0",
+			}},
+		})
+	})
+	mux.HandleFunc("/v2/bitnami/wordpress/blobs/sha256:1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(chartLayer(t, "wordpress"))
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := oci.NewClient(ts.URL, oci.Auth{})
+	repo := OCIRepo{RepoName: "bitnami/wordpress", Repo: models.Repo{Name: "bitnami", Type: "oci"}}
+
+	synced, err := SyncOCIRepo(client, repo, filter.Spec{NameGlobs: []string{"mysql*"}})
+	assert.NoError(t, err)
+	assert.Empty(t, synced)
+}
@@ -0,0 +1,193 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/models"
+)
+
+// resolvedDependency is one entry of the resolved dependency graph. Error is
+// set instead of Version when the dependency (or one of its own
+// dependencies) couldn't be found, so the dashboard can surface a "missing
+// dependency" warning without failing the whole request.
+type resolvedDependency struct {
+	Name       string `json:"name"`
+	Repository string `json:"repository,omitempty"`
+	Alias      string `json:"alias,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// dependencyLock is the Chart.lock-shaped response returned by the
+// dependencies endpoint.
+type dependencyLock struct {
+	Digest       string               `json:"digest"`
+	Dependencies []resolvedDependency `json:"dependencies"`
+}
+
+// dependencyCycleError is returned when resolving a chart's dependency graph
+// would revisit a chart already on the current resolution path.
+type dependencyCycleError struct {
+	Path []string
+}
+
+func (e *dependencyCycleError) Error() string {
+	return fmt.Sprintf("dependency cycle detected: %s", strings.Join(e.Path, " -> "))
+}
+
+// resolveDependencies walks chart's Chart.yaml dependencies, resolving each
+// one against the local `charts` table (highest version satisfying the
+// declared semver constraint, falling back to an exact string match when
+// the constraint isn't valid semver) and recursing into the resolved
+// chart's own dependencies. It returns a dependencyCycleError if the graph
+// isn't a DAG; any other resolution failure is recorded per-entry instead of
+// aborting the request.
+func resolveDependencies(m assetManager, namespace string, chart models.Chart, version string) (*dependencyLock, error) {
+	var chartVersion *models.ChartVersion
+	for i := range chart.ChartVersions {
+		if chart.ChartVersions[i].Version == version {
+			chartVersion = &chart.ChartVersions[i]
+			break
+		}
+	}
+	if chartVersion == nil {
+		return nil, fmt.Errorf("version %q not found for chart %s", version, chart.ID)
+	}
+
+	resolved := []resolvedDependency{}
+	path := []string{chart.ID + "@" + version}
+	for _, dep := range chartVersion.Dependencies {
+		entry, err := resolveDependency(m, namespace, dep, path)
+		if cycle, ok := err.(*dependencyCycleError); ok {
+			return nil, cycle
+		}
+		resolved = append(resolved, entry)
+	}
+
+	return &dependencyLock{Digest: digestDependencies(resolved), Dependencies: resolved}, nil
+}
+
+func resolveDependency(m assetManager, namespace string, dep models.Dependency, path []string) (resolvedDependency, error) {
+	entry := resolvedDependency{Name: dep.Name, Repository: dep.Repository, Alias: dep.Alias}
+
+	repoName, err := resolveDependencyRepo(m, namespace, dep.Repository)
+	if err != nil {
+		entry.Error = fmt.Sprintf("missing dependency: %v", err)
+		return entry, nil
+	}
+
+	depChartID := repoName + "/" + dep.Name
+	for _, visited := range path {
+		if strings.HasPrefix(visited, depChartID+"@") {
+			cyclePath := append(append([]string{}, path...), depChartID)
+			return entry, &dependencyCycleError{Path: cyclePath}
+		}
+	}
+
+	depChart, err := m.getChart(namespace, depChartID)
+	if err != nil {
+		entry.Error = fmt.Sprintf("missing dependency: %v", err)
+		return entry, nil
+	}
+
+	version, err := highestSatisfying(depChart.ChartVersions, dep.Version)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry, nil
+	}
+	entry.Version = version.Version
+
+	nestedPath := append(append([]string{}, path...), depChartID+"@"+version.Version)
+	for _, nestedDep := range version.Dependencies {
+		nestedEntry, err := resolveDependency(m, namespace, nestedDep, nestedPath)
+		if err != nil {
+			return entry, err
+		}
+		if nestedEntry.Error != "" && entry.Error == "" {
+			entry.Error = fmt.Sprintf("%s: %s", nestedDep.Name, nestedEntry.Error)
+		}
+	}
+	if entry.Error != "" {
+		entry.Version = ""
+	}
+
+	return entry, nil
+}
+
+// resolveDependencyRepo maps a Chart.yaml dependency's `repository` field --
+// a repo URL such as "https://charts.bitnami.com/bitnami", a "@name" alias,
+// or (as emitted by older tooling and our own tests) an already-local repo
+// name -- to the repo_name charts are stored under in the `charts` table, so
+// depChartID lines up with the `repo/chartName` ids getChart expects.
+func resolveDependencyRepo(m assetManager, namespace, repository string) (string, error) {
+	if repository == "" || strings.HasPrefix(repository, "@") {
+		return strings.TrimPrefix(repository, "@"), nil
+	}
+
+	backends, err := m.listRepoBackends(namespace)
+	if err != nil {
+		return "", err
+	}
+	for _, b := range backends {
+		if strings.TrimSuffix(b.URL, "/") == strings.TrimSuffix(repository, "/") {
+			return b.Name, nil
+		}
+	}
+	// Not a URL we recognise; assume it's already a local repo name.
+	return repository, nil
+}
+
+// highestSatisfying returns the highest version among versions that
+// satisfies the semver constraint. When constraint isn't a valid semver
+// range, it falls back to Helm's versionEquals behavior: an exact
+// string match against constraint.
+func highestSatisfying(versions []models.ChartVersion, constraint string) (models.ChartVersion, error) {
+	if constraint == "" {
+		constraint = "*"
+	}
+
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		for _, v := range versions {
+			if v.Version == constraint {
+				return v, nil
+			}
+		}
+		return models.ChartVersion{}, fmt.Errorf("no version matching %q", constraint)
+	}
+
+	var best *models.ChartVersion
+	var bestSemver *semver.Version
+	for i := range versions {
+		sv, err := semver.NewVersion(versions[i].Version)
+		if err != nil || !c.Check(sv) {
+			continue
+		}
+		if best == nil || sv.GreaterThan(bestSemver) {
+			best = &versions[i]
+			bestSemver = sv
+		}
+	}
+	if best == nil {
+		return models.ChartVersion{}, fmt.Errorf("no version satisfying constraint %q", constraint)
+	}
+	return *best, nil
+}
+
+func digestDependencies(deps []resolvedDependency) string {
+	versions := make([]string, 0, len(deps))
+	for _, d := range deps {
+		versions = append(versions, d.Name+"@"+d.Version)
+	}
+	sort.Strings(versions)
+	sum := sha256.Sum256([]byte(strings.Join(versions, ",")))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
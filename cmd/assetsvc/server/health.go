@@ -0,0 +1,121 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// healthStatus is either "ok" or "down".
+type healthStatus string
+
+const (
+	healthOK   healthStatus = "ok"
+	healthDown healthStatus = "down"
+)
+
+// repoBackend is the subset of a repo's configuration needed to probe its
+// upstream reachability.
+type repoBackend struct {
+	Name       string
+	Type       string // "helm" (classic index.yaml) or "oci"
+	URL        string
+	LastSyncAt *time.Time
+}
+
+// healthCheck is a single probe result within a health report.
+type healthCheck struct {
+	Name       string       `json:"name"`
+	Status     healthStatus `json:"status"`
+	LatencyMs  int64        `json:"latencyMs"`
+	LastSyncAt *time.Time   `json:"lastSyncAt,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// healthReport is the body returned by /health.
+type healthReport struct {
+	Status healthStatus  `json:"status"`
+	Checks []healthCheck `json:"checks"`
+}
+
+// httpPinger is implemented by http.Client; overridden in tests.
+type httpPinger interface {
+	Get(url string) (*http.Response, error)
+}
+
+var healthHTTPClient httpPinger = &http.Client{Timeout: 5 * time.Second}
+
+// buildHealthReport probes Postgres connectivity and every configured repo
+// backend (HTTP index.yaml reachability or OCI registry /v2/ ping), and
+// reports each repo's last successful sync time from the DB.
+func buildHealthReport(m assetManager, namespace string) healthReport {
+	checks := []healthCheck{checkPostgres(m)}
+
+	repos, err := m.listRepoBackends(namespace)
+	if err != nil {
+		checks = append(checks, healthCheck{Name: "repos", Status: healthDown, Error: err.Error()})
+	} else {
+		for _, repo := range repos {
+			checks = append(checks, checkRepoBackend(repo))
+		}
+	}
+
+	report := healthReport{Status: healthOK, Checks: checks}
+	for _, c := range checks {
+		if c.Status == healthDown {
+			report.Status = healthDown
+			break
+		}
+	}
+	return report
+}
+
+func checkPostgres(m assetManager) healthCheck {
+	start := time.Now()
+	err := m.ping()
+	check := healthCheck{Name: "postgres", LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		check.Status = healthDown
+		check.Error = err.Error()
+	} else {
+		check.Status = healthOK
+	}
+	return check
+}
+
+func checkRepoBackend(repo repoBackend) healthCheck {
+	start := time.Now()
+	check := healthCheck{Name: repo.Name, LastSyncAt: repo.LastSyncAt}
+
+	url := repo.URL + "/index.yaml"
+	if repo.Type == "oci" {
+		url = fmt.Sprintf("https://%s/v2/", repo.URL)
+	}
+
+	res, err := healthHTTPClient.Get(url)
+	check.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		check.Status = healthDown
+		check.Error = err.Error()
+		return check
+	}
+	defer res.Body.Close()
+
+	// The OCI Distribution Spec only guarantees /v2/ returns 200; a classic
+	// index.yaml just needs to be fetchable.
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		check.Status = healthOK
+	} else {
+		check.Status = healthDown
+		check.Error = fmt.Sprintf("unexpected status %s", res.Status)
+	}
+	return check
+}
+
+func getHealth(w http.ResponseWriter, r *http.Request) {
+	report := buildHealthReport(manager, globalReposNamespace)
+	writeResponse(w, report)
+}
@@ -0,0 +1,220 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmware-tanzu/kubeapps/cmd/asset-syncer/pkg/filter"
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/models"
+)
+
+// assetManager is the persistence layer consumed by the HTTP handlers in
+// this package. postgresAssetManager is the production implementation; a
+// sqlmock-backed stand-in is installed in tests via setMockManager.
+type assetManager interface {
+	getChart(namespace, chartID string) (models.Chart, error)
+	getChartFiles(namespace, filesID string) (models.ChartFiles, error)
+	getAllChartCategories(namespace string, repo ...string) ([]*models.ChartCategory, error)
+	addChartVersionLabel(namespace, chartID, version string, label models.Label) error
+	removeChartVersionLabel(namespace, chartID, version, labelName string) error
+	getRepoFilter(namespace, repo string) (filter.Spec, error)
+	searchCharts(namespace string, params searchParams) (searchResult, error)
+	ping() error
+	listRepoBackends(namespace string) ([]repoBackend, error)
+}
+
+// postgresAssetManager implements assetManager against the `charts` and
+// `files` tables populated by the asset-syncer.
+type postgresAssetManager struct {
+	db *sql.DB
+}
+
+func (m *postgresAssetManager) getChart(namespace, chartID string) (models.Chart, error) {
+	var chart models.Chart
+	var chartJSON []byte
+	// addChartVersionLabel/removeChartVersionLabel keep info->'labels' (the
+	// union of every version's labels) and each entry of
+	// info->'chartVersions'[].labels in sync whenever a label changes, so a
+	// plain read of `info` already reflects the latest labels here.
+	row := m.db.QueryRow("SELECT info FROM charts WHERE namespace = $1 AND chart_id = $2", namespace, chartID)
+	if err := row.Scan(&chartJSON); err != nil {
+		return chart, err
+	}
+	if err := json.Unmarshal(chartJSON, &chart); err != nil {
+		return chart, err
+	}
+	return chart, nil
+}
+
+// addChartVersionLabel attaches a label to a chart version, persisting it in
+// chart_labels and updating the denormalized `labels` array on the chart's
+// `info` column so getChart keeps serving it without an extra join.
+func (m *postgresAssetManager) addChartVersionLabel(namespace, chartID, version string, label models.Label) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT INTO chart_labels (namespace, chart_id, version, name, value) VALUES ($1, $2, $3, $4, $5) "+
+			"ON CONFLICT (namespace, chart_id, version, name) DO UPDATE SET value = excluded.value",
+		namespace, chartID, version, label.Name, label.Value,
+	); err != nil {
+		return err
+	}
+
+	if err := m.refreshChartLabels(tx, namespace, chartID, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// removeChartVersionLabel detaches a label from a chart version.
+func (m *postgresAssetManager) removeChartVersionLabel(namespace, chartID, version, labelName string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"DELETE FROM chart_labels WHERE namespace = $1 AND chart_id = $2 AND version = $3 AND name = $4",
+		namespace, chartID, version, labelName,
+	); err != nil {
+		return err
+	}
+
+	if err := m.refreshChartLabels(tx, namespace, chartID, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// refreshChartLabels recomputes the chart-wide `labels` array embedded in a
+// chart's `info` JSONB column (the union of labels across every version)
+// and the per-version `labels` array of the single entry in
+// `info->'chartVersions'` matching version, both from the current contents
+// of chart_labels.
+func (m *postgresAssetManager) refreshChartLabels(tx *sql.Tx, namespace, chartID, version string) error {
+	_, err := tx.Exec(
+		"UPDATE charts SET info = jsonb_set("+
+			"jsonb_set(info, '{labels}', COALESCE("+
+			"(SELECT jsonb_agg(DISTINCT jsonb_build_object('name', name, 'value', value)) "+
+			"FROM chart_labels WHERE namespace = $1 AND chart_id = $2), '[]'::jsonb)), "+
+			"'{chartVersions}', COALESCE("+
+			"(SELECT jsonb_agg("+
+			"CASE WHEN elem ->> 'version' = $3 THEN jsonb_set(elem, '{labels}', COALESCE("+
+			"(SELECT jsonb_agg(jsonb_build_object('name', name, 'value', value)) "+
+			"FROM chart_labels WHERE namespace = $1 AND chart_id = $2 AND version = $3), '[]'::jsonb)) "+
+			"ELSE elem END ORDER BY ord) "+
+			"FROM jsonb_array_elements(info -> 'chartVersions') WITH ORDINALITY AS t(elem, ord)), "+
+			"info -> 'chartVersions')) "+
+			"WHERE namespace = $1 AND chart_id = $2",
+		namespace, chartID, version,
+	)
+	return err
+}
+
+func (m *postgresAssetManager) getChartFiles(namespace, filesID string) (models.ChartFiles, error) {
+	var files models.ChartFiles
+	var filesJSON []byte
+	row := m.db.QueryRow("SELECT info FROM files WHERE namespace = $1 AND files_id = $2", namespace, filesID)
+	if err := row.Scan(&filesJSON); err != nil {
+		return files, err
+	}
+	if err := json.Unmarshal(filesJSON, &files); err != nil {
+		return files, err
+	}
+	return files, nil
+}
+
+func (m *postgresAssetManager) getAllChartCategories(namespace string, repo ...string) ([]*models.ChartCategory, error) {
+	query := "SELECT (info ->> 'category')::text AS name, COUNT(*) AS count FROM charts WHERE (namespace = $1 OR namespace = $2)"
+	args := []interface{}{namespace, globalReposNamespace}
+	if len(repo) > 0 {
+		query += " AND repo_name = $3"
+		args = append(args, repo[0])
+	}
+	query += " GROUP BY (info ->> 'category') ORDER BY (info ->> 'category') ASC"
+
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*models.ChartCategory{}
+	for rows.Next() {
+		c := &models.ChartCategory{}
+		if err := rows.Scan(&c.Name, &c.Count); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// getRepoFilter returns the filter.Spec that the asset-syncer applied the
+// last time it synced the given repo, as recorded in the `repo_filters`
+// table.
+func (m *postgresAssetManager) getRepoFilter(namespace, repo string) (filter.Spec, error) {
+	var spec filter.Spec
+	var specJSON []byte
+	row := m.db.QueryRow("SELECT filter FROM repo_filters WHERE namespace = $1 AND repo_name = $2", namespace, repo)
+	if err := row.Scan(&specJSON); err != nil {
+		return spec, err
+	}
+	if err := json.Unmarshal(specJSON, &spec); err != nil {
+		return spec, err
+	}
+	return spec, nil
+}
+
+// ping confirms the database connection backing assetsvc is reachable.
+func (m *postgresAssetManager) ping() error {
+	return m.db.Ping()
+}
+
+// listRepoBackends returns every repo configured for namespace, along with
+// the type/URL needed to probe its upstream reachability and the last time
+// it was successfully synced. `repos` (repo_name, repo_type, repo_url,
+// last_sync_at) is populated by the apprepository-controller reconciling
+// AppRepository custom resources, not by anything in this package, so it
+// predates and is out of scope for the migrations in database/migrations.
+func (m *postgresAssetManager) listRepoBackends(namespace string) ([]repoBackend, error) {
+	rows, err := m.db.Query(
+		"SELECT repo_name, repo_type, repo_url, last_sync_at FROM repos WHERE namespace = $1 OR namespace = $2",
+		namespace, globalReposNamespace,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backends := []repoBackend{}
+	for rows.Next() {
+		var b repoBackend
+		if err := rows.Scan(&b.Name, &b.Type, &b.URL, &b.LastSyncAt); err != nil {
+			return nil, err
+		}
+		backends = append(backends, b)
+	}
+	return backends, rows.Err()
+}
+
+// newPostgresManager opens a connection to the Postgres database backing
+// assetsvc using the given DSN.
+func newPostgresManager(dsn string) (*postgresAssetManager, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database connection: %w", err)
+	}
+	return &postgresAssetManager{db: db}, nil
+}
@@ -0,0 +1,279 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/models"
+)
+
+const (
+	defaultSearchPage = 1
+	defaultSearchSize = 20
+
+	searchDocExpr = `to_tsvector('english',
+		coalesce(info ->> 'name', '') || ' ' ||
+		coalesce(info ->> 'description', '') || ' ' ||
+		coalesce(info -> 'keywords', '[]'::jsonb)::text || ' ' ||
+		coalesce(info -> 'maintainers', '[]'::jsonb)::text
+	)`
+)
+
+// searchParams is the parsed form of the `GET /charts/search` query
+// parameters.
+type searchParams struct {
+	Query       string
+	Repos       []string
+	Categories  []string
+	Keywords    []string
+	Maintainers []string
+	Page        int
+	Size        int
+	// Sort is either "rank" (default, by ts_rank_cd) or "name".
+	Sort string
+}
+
+// facetCount is a single value/count pair within a facet.
+type facetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// searchFacets groups facet counts by the dimension they aggregate.
+type searchFacets struct {
+	Repos       []facetCount `json:"repos"`
+	Categories  []facetCount `json:"categories"`
+	Maintainers []facetCount `json:"maintainers"`
+}
+
+// searchResult is the paginated response for `GET /charts/search`.
+type searchResult struct {
+	Charts []*models.Chart `json:"charts"`
+	Page   int             `json:"page"`
+	Size   int             `json:"size"`
+	Total  int             `json:"total"`
+	Facets searchFacets    `json:"facets"`
+}
+
+// whereClause accumulates `AND`-ed conditions and their positional args,
+// assigning placeholders in the order they're added so callers don't have to
+// hand-count $N across a query built from several optional filters.
+type whereClause struct {
+	clauses []string
+	args    []interface{}
+}
+
+func newWhereClause(namespace string) *whereClause {
+	w := &whereClause{}
+	w.add("(namespace = %s OR namespace = %s)", namespace, globalReposNamespace)
+	return w
+}
+
+func (w *whereClause) add(format string, args ...interface{}) {
+	placeholders := make([]interface{}, len(args))
+	for i, a := range args {
+		w.args = append(w.args, a)
+		placeholders[i] = fmt.Sprintf("$%d", len(w.args))
+	}
+	w.clauses = append(w.clauses, fmt.Sprintf(format, placeholders...))
+}
+
+func (w *whereClause) addIn(column string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		w.args = append(w.args, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(w.args))
+	}
+	w.clauses = append(w.clauses, fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", ")))
+}
+
+func (w *whereClause) sql() string {
+	return strings.Join(w.clauses, " AND ")
+}
+
+// addJSONBArrayOverlap restricts results to rows where `expr` (a jsonb array
+// of scalars, e.g. info -> 'keywords') contains at least one of values.
+func (w *whereClause) addJSONBArrayOverlap(expr string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		w.args = append(w.args, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(w.args))
+	}
+	w.clauses = append(w.clauses, fmt.Sprintf(
+		"EXISTS (SELECT 1 FROM jsonb_array_elements_text(%s) elem WHERE elem IN (%s))",
+		expr, strings.Join(placeholders, ", ")))
+}
+
+// placeholder allocates the next positional placeholder for a value that
+// isn't part of the WHERE clause (e.g. the tsquery text, LIMIT, OFFSET) so
+// it can be appended after the WHERE args without colliding with them.
+func (w *whereClause) placeholder(value interface{}) string {
+	w.args = append(w.args, value)
+	return fmt.Sprintf("$%d", len(w.args))
+}
+
+func (p searchParams) where(namespace string) *whereClause {
+	w := newWhereClause(namespace)
+	w.addIn("repo_name", p.Repos)
+	w.addIn("(info ->> 'category')", p.Categories)
+	w.addJSONBArrayOverlap("coalesce(info -> 'keywords', '[]'::jsonb)", p.Keywords)
+	if len(p.Maintainers) > 0 {
+		placeholders := make([]string, len(p.Maintainers))
+		for i, v := range p.Maintainers {
+			w.args = append(w.args, v)
+			placeholders[i] = fmt.Sprintf("$%d", len(w.args))
+		}
+		w.clauses = append(w.clauses, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM jsonb_array_elements(coalesce(info -> 'maintainers', '[]'::jsonb)) m WHERE (m ->> 'name') IN (%s))",
+			strings.Join(placeholders, ", ")))
+	}
+	return w
+}
+
+func (m *postgresAssetManager) searchCharts(namespace string, p searchParams) (searchResult, error) {
+	if p.Page < 1 {
+		p.Page = defaultSearchPage
+	}
+	if p.Size < 1 {
+		p.Size = defaultSearchSize
+	}
+
+	w := p.where(namespace)
+	queryPlaceholder := w.placeholder(p.Query)
+	limitPlaceholder := w.placeholder(p.Size)
+	offsetPlaceholder := w.placeholder((p.Page - 1) * p.Size)
+
+	order := fmt.Sprintf("ts_rank_cd(%s, plainto_tsquery('english', %s)) DESC, (info ->> 'name') = %s DESC", searchDocExpr, queryPlaceholder, queryPlaceholder)
+	if p.Sort == "name" {
+		order = "(info ->> 'name') ASC"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT info, count(*) OVER() AS total
+		FROM charts
+		WHERE %s AND (%s = '' OR %s @@ plainto_tsquery('english', %s))
+		ORDER BY %s
+		LIMIT %s OFFSET %s`,
+		w.sql(), queryPlaceholder, searchDocExpr, queryPlaceholder, order, limitPlaceholder, offsetPlaceholder)
+
+	rows, err := m.db.Query(query, w.args...)
+	if err != nil {
+		return searchResult{}, err
+	}
+	defer rows.Close()
+
+	result := searchResult{Page: p.Page, Size: p.Size, Charts: []*models.Chart{}}
+	for rows.Next() {
+		var chartJSON []byte
+		if err := rows.Scan(&chartJSON, &result.Total); err != nil {
+			return searchResult{}, err
+		}
+		chart := &models.Chart{}
+		if err := json.Unmarshal(chartJSON, chart); err != nil {
+			return searchResult{}, err
+		}
+		result.Charts = append(result.Charts, chart)
+	}
+	if err := rows.Err(); err != nil {
+		return searchResult{}, err
+	}
+
+	result.Facets, err = m.searchFacets(namespace, p)
+	if err != nil {
+		return searchResult{}, err
+	}
+	return result, nil
+}
+
+// searchFacets computes per-repo, per-category and per-maintainer counts for
+// the same filter set as searchCharts, ignoring pagination.
+func (m *postgresAssetManager) searchFacets(namespace string, p searchParams) (searchFacets, error) {
+	var facets searchFacets
+
+	repoCounts, err := m.facetCounts("repo_name", namespace, p)
+	if err != nil {
+		return facets, err
+	}
+	facets.Repos = repoCounts
+
+	categoryCounts, err := m.facetCounts("(info ->> 'category')", namespace, p)
+	if err != nil {
+		return facets, err
+	}
+	facets.Categories = categoryCounts
+
+	maintainerCounts, err := m.maintainerFacetCounts(namespace, p)
+	if err != nil {
+		return facets, err
+	}
+	facets.Maintainers = maintainerCounts
+
+	return facets, nil
+}
+
+func (m *postgresAssetManager) facetCounts(column string, namespace string, p searchParams) ([]facetCount, error) {
+	w := p.where(namespace)
+	queryPlaceholder := w.placeholder(p.Query)
+	query := fmt.Sprintf(
+		"SELECT coalesce(%s, ''), count(*) FROM charts WHERE %s AND (%s = '' OR %s @@ plainto_tsquery('english', %s)) GROUP BY 1",
+		column, w.sql(), queryPlaceholder, searchDocExpr, queryPlaceholder)
+
+	rows, err := m.db.Query(query, w.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []facetCount{}
+	for rows.Next() {
+		var c facetCount
+		if err := rows.Scan(&c.Value, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// maintainerFacetCounts counts charts per maintainer name. Unlike
+// facetCounts, it can't just plug a column expression into the common
+// query shape: info -> 'maintainers' is a JSON array, so expanding it with
+// jsonb_array_elements has to happen in a LATERAL join rather than the
+// SELECT list, where a set-returning function grouped alongside count(*)
+// is rejected by Postgres.
+func (m *postgresAssetManager) maintainerFacetCounts(namespace string, p searchParams) ([]facetCount, error) {
+	w := p.where(namespace)
+	queryPlaceholder := w.placeholder(p.Query)
+	query := fmt.Sprintf(`
+		SELECT coalesce(maintainer.value ->> 'name', ''), count(*)
+		FROM charts, LATERAL jsonb_array_elements(coalesce(info -> 'maintainers', '[]'::jsonb)) AS maintainer(value)
+		WHERE %s AND (%s = '' OR %s @@ plainto_tsquery('english', %s))
+		GROUP BY 1`,
+		w.sql(), queryPlaceholder, searchDocExpr, queryPlaceholder)
+
+	rows, err := m.db.Query(query, w.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []facetCount{}
+	for rows.Next() {
+		var c facetCount
+		if err := rows.Scan(&c.Value, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,320 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package server implements the HTTP API exposed by assetsvc: a view over
+// the charts and chart files synced into Postgres by the asset-syncer, plus
+// endpoints that attach and remove chart-version labels.
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/models"
+)
+
+const (
+	pathPrefix           = "/v1"
+	globalReposNamespace = "kubeapps"
+)
+
+// manager is the database-backed implementation used to look up charts and
+// their files. It is swapped out for a mock in tests via setMockManager.
+var manager assetManager
+
+// bodyAPIResponse wraps a single resource in the envelope returned by every
+// endpoint in this package.
+type bodyAPIResponse struct {
+	Data interface{} `json:"data"`
+}
+
+// bodyAPIListResponse wraps a collection of resources.
+type bodyAPIListResponse struct {
+	Data *[]interface{} `json:"data"`
+}
+
+// setupRoutes wires up every endpoint served by assetsvc.
+func setupRoutes() http.Handler {
+	r := mux.NewRouter()
+
+	r.HandleFunc("/live", getLive).Methods("GET")
+	r.HandleFunc("/ready", getReady).Methods("GET")
+	r.HandleFunc("/health", getHealth).Methods("GET")
+
+	apiv1 := r.PathPrefix(pathPrefix).Subrouter()
+
+	charts := apiv1.PathPrefix("/clusters/{cluster}/namespaces/{namespace}/charts").Subrouter()
+	charts.HandleFunc("/search", searchChartsHandler).Methods("GET")
+	charts.HandleFunc("/categories", getChartCategories).Methods("GET")
+	charts.HandleFunc("/{repo}/categories", getChartCategoriesRepo).Methods("GET")
+	charts.HandleFunc("/{repo}/{chartName}", getChart).Methods("GET")
+	charts.HandleFunc("/{repo}/{chartName}/versions", listChartVersions).Methods("GET")
+	charts.HandleFunc("/{repo}/{chartName}/versions/{version}", getChartVersion).Methods("GET")
+	charts.HandleFunc("/{repo}/{chartName}/versions/{version}/labels", addChartVersionLabel).Methods("POST")
+	charts.HandleFunc("/{repo}/{chartName}/versions/{version}/labels", removeChartVersionLabel).Methods("DELETE")
+	charts.HandleFunc("/{repo}/{chartName}/versions/{version}/dependencies", getChartDependencies).Methods("GET")
+
+	repos := apiv1.PathPrefix("/clusters/{cluster}/namespaces/{namespace}/repos").Subrouter()
+	repos.HandleFunc("/{repo}/filter", getRepoFilter).Methods("GET")
+
+	assets := apiv1.PathPrefix("/clusters/{cluster}/namespaces/{namespace}/assets").Subrouter()
+	assets.HandleFunc("/{repo}/{chartName}/logo", getChartIcon).Methods("GET")
+	assets.HandleFunc("/{repo}/{chartName}/versions/{version}/README.md", getChartReadme).Methods("GET")
+	assets.HandleFunc("/{repo}/{chartName}/versions/{version}/values.yaml", getChartValues).Methods("GET")
+	assets.HandleFunc("/{repo}/{chartName}/versions/{version}/values.schema.json", getChartSchema).Methods("GET")
+
+	return r
+}
+
+func getLive(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// getReady fails with 503 if Postgres, the only critical local dependency,
+// is down, unlike getLive which is a pure process-liveness probe. It
+// deliberately doesn't probe configured repo backends the way /health does:
+// a single unreachable upstream chart repo shouldn't pull assetsvc out of
+// its Service when it can still serve everything already synced into
+// Postgres.
+func getReady(w http.ResponseWriter, r *http.Request) {
+	if check := checkPostgres(manager); check.Status != healthOK {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// searchChartsHandler serves a full-text, faceted search over the charts
+// synced into Postgres. `q` is matched against name/description/keywords/
+// maintainers; `repos` and `categories` narrow the result set; `page`/`size`
+// paginate; `sort` is "rank" (default) or "name".
+func searchChartsHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	q := r.URL.Query()
+
+	params := searchParams{
+		Query:       q.Get("q"),
+		Repos:       splitCSV(q.Get("repos")),
+		Categories:  splitCSV(q.Get("categories")),
+		Keywords:    splitCSV(q.Get("keywords")),
+		Maintainers: splitCSV(q.Get("maintainers")),
+		Sort:        q.Get("sort"),
+	}
+	if page, err := strconv.Atoi(q.Get("page")); err == nil {
+		params.Page = page
+	}
+	if size, err := strconv.Atoi(q.Get("size")); err == nil {
+		params.Size = size
+	}
+
+	result, err := manager.searchCharts(namespace, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, result)
+}
+
+func splitCSV(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func getChartCategories(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	categories, err := manager.getAllChartCategories(namespace)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeListResponse(w, categories)
+}
+
+func getChartCategoriesRepo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	categories, err := manager.getAllChartCategories(vars["namespace"], vars["repo"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeListResponse(w, categories)
+}
+
+func getChart(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chart, err := manager.getChart(vars["namespace"], vars["repo"]+"/"+vars["chartName"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeResponse(w, chart)
+}
+
+func listChartVersions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chart, err := manager.getChart(vars["namespace"], vars["repo"]+"/"+vars["chartName"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeResponse(w, chart.ChartVersions)
+}
+
+func getChartVersion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chart, err := manager.getChart(vars["namespace"], vars["repo"]+"/"+vars["chartName"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	for _, v := range chart.ChartVersions {
+		if v.Version == vars["version"] {
+			writeResponse(w, v)
+			return
+		}
+	}
+	http.Error(w, "chart version not found", http.StatusNotFound)
+}
+
+// addChartVersionLabel attaches a label (e.g. "certified" or "team=platform")
+// to a chart version. The request body is the JSON-encoded models.Label.
+func addChartVersionLabel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var label models.Label
+	if err := json.NewDecoder(r.Body).Decode(&label); err != nil {
+		http.Error(w, "unable to parse label", http.StatusBadRequest)
+		return
+	}
+	if label.Name == "" {
+		http.Error(w, "label name is required", http.StatusBadRequest)
+		return
+	}
+	chartID := vars["repo"] + "/" + vars["chartName"]
+	if err := manager.addChartVersionLabel(vars["namespace"], chartID, vars["version"], label); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// removeChartVersionLabel detaches a label from a chart version. The label
+// name to remove is given as the `name` query parameter.
+func removeChartVersionLabel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	labelName := r.URL.Query().Get("name")
+	if labelName == "" {
+		http.Error(w, "name query parameter is required", http.StatusBadRequest)
+		return
+	}
+	chartID := vars["repo"] + "/" + vars["chartName"]
+	if err := manager.removeChartVersionLabel(vars["namespace"], chartID, vars["version"], labelName); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// getRepoFilter returns the --filter-name/--filter-annotation set the
+// asset-syncer applied the last time it synced this repo.
+func getRepoFilter(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	spec, err := manager.getRepoFilter(vars["namespace"], vars["repo"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeResponse(w, spec)
+}
+
+// getChartDependencies returns the fully-resolved dependency graph for a
+// chart version, in the same shape as Helm's Chart.lock.
+func getChartDependencies(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chart, err := manager.getChart(vars["namespace"], vars["repo"]+"/"+vars["chartName"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	lock, err := resolveDependencies(manager, vars["namespace"], chart, vars["version"])
+	if err != nil {
+		if cycle, ok := err.(*dependencyCycleError); ok {
+			http.Error(w, cycle.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeResponse(w, lock)
+}
+
+func getChartIcon(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chart, err := manager.getChart(vars["namespace"], vars["repo"]+"/"+vars["chartName"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if len(chart.RawIcon) == 0 {
+		http.Error(w, "icon not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	_, _ = w.Write(chart.RawIcon)
+}
+
+func getChartReadme(w http.ResponseWriter, r *http.Request) {
+	writeChartFile(w, r, func(f models.ChartFiles) (string, bool) { return f.Readme, f.Readme != "" })
+}
+
+func getChartValues(w http.ResponseWriter, r *http.Request) {
+	writeChartFile(w, r, func(f models.ChartFiles) (string, bool) { return f.Values, true })
+}
+
+func getChartSchema(w http.ResponseWriter, r *http.Request) {
+	writeChartFile(w, r, func(f models.ChartFiles) (string, bool) { return f.Schema, true })
+}
+
+func writeChartFile(w http.ResponseWriter, r *http.Request, pick func(models.ChartFiles) (string, bool)) {
+	vars := mux.Vars(r)
+	files, err := manager.getChartFiles(vars["namespace"], vars["repo"]+"/"+vars["chartName"]+"-"+vars["version"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	content, ok := pick(files)
+	if !ok {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write([]byte(content))
+}
+
+func writeResponse(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(bodyAPIResponse{Data: data}); err != nil {
+		log.Printf("unable to encode response: %v", err)
+	}
+}
+
+func writeListResponse(w http.ResponseWriter, data interface{}) {
+	list := make([]interface{}, 0)
+	switch v := data.(type) {
+	case []*models.ChartCategory:
+		for _, c := range v {
+			list = append(list, c)
+		}
+	default:
+		list = append(list, v)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(bodyAPIListResponse{Data: &list}); err != nil {
+		log.Printf("unable to encode response: %v", err)
+	}
+}
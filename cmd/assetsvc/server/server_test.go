@@ -4,14 +4,17 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/vmware-tanzu/kubeapps/cmd/asset-syncer/pkg/filter"
 	"github.com/vmware-tanzu/kubeapps/pkg/chart/models"
 )
 
@@ -29,18 +32,62 @@ func Test_GetLive(t *testing.T) {
 	assert.Equal(t, res.StatusCode, http.StatusOK, "http status code should match")
 }
 
-// tests the GET /ready endpoint
+// tests the GET /ready endpoint: it only gates on Postgres being reachable,
+// not on any configured repo backend, so a single flaky upstream chart repo
+// can't pull assetsvc out of its Service.
 func Test_GetReady(t *testing.T) {
-	_, cleanup := setMockManager(t)
-	defer cleanup()
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	t.Run("postgres reachable", func(t *testing.T) {
+		_, cleanup := setMockManager(t)
+		defer cleanup()
+
+		res, err := http.Get(ts.URL + "/ready")
+		assert.NoError(t, err, "should not return an error")
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode, "http status code should match")
+	})
+
+	t.Run("postgres unreachable", func(t *testing.T) {
+		_, cleanup := setMockManager(t)
+		defer cleanup()
+		manager.(*postgresAssetManager).db.Close()
+
+		res, err := http.Get(ts.URL + "/ready")
+		assert.NoError(t, err, "should not return an error")
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode, "http status code should match")
+	})
+}
 
+// tests the GET /health endpoint: it always returns 200, with the aggregated
+// status and per-backend checks in the body.
+func Test_GetHealth(t *testing.T) {
 	ts := httptest.NewServer(setupRoutes())
 	defer ts.Close()
 
-	res, err := http.Get(ts.URL + "/ready")
+	mock, cleanup := setMockManager(t)
+	defer cleanup()
+	defer stubHealthHTTPClient(t)()
+
+	lastSync := time.Now().Add(-time.Hour)
+	mock.ExpectQuery("SELECT repo_name, repo_type, repo_url, last_sync_at FROM repos").
+		WillReturnRows(sqlmock.NewRows([]string{"repo_name", "repo_type", "repo_url", "last_sync_at"}).
+			AddRow("my-repo", "helm", "https://charts.example.com", lastSync))
+
+	res, err := http.Get(ts.URL + "/health")
 	assert.NoError(t, err, "should not return an error")
 	defer res.Body.Close()
-	assert.Equal(t, res.StatusCode, http.StatusOK, "http status code should match")
+	assert.Equal(t, http.StatusOK, res.StatusCode, "http status code should match")
+
+	var b struct {
+		Data healthReport `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&b))
+	assert.Equal(t, "postgres", b.Data.Checks[0].Name)
+	assert.Len(t, b.Data.Checks, 2)
+	assert.Equal(t, "my-repo", b.Data.Checks[1].Name)
 }
 
 // tests the GET /{apiVersion}/clusters/default/namespaces/{namespace}/charts/categories endpoint
@@ -216,6 +263,73 @@ func Test_GetChartInRepo(t *testing.T) {
 			assert.Equal(t, res.StatusCode, tt.wantCode, "http status code should match")
 		})
 	}
+
+	t.Run("labels are surfaced on the chart and its versions", func(t *testing.T) {
+		mock, cleanup := setMockManager(t)
+		defer cleanup()
+
+		chart := models.Chart{
+			Repo:   testRepo,
+			ID:     "my-repo/my-chart",
+			Labels: []models.Label{{Name: "certified"}},
+			ChartVersions: []models.ChartVersion{
+				{Version: "0.1.0", Labels: []models.Label{{Name: "team", Value: "platform"}}},
+			},
+		}
+		chartJSON, err := json.Marshal(chart)
+		assert.NoError(t, err)
+
+		mock.ExpectQuery("SELECT info FROM charts WHERE *").
+			WithArgs("my-namespace", chart.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"info"}).AddRow(chartJSON))
+
+		res, err := http.Get(ts.URL + pathPrefix + "/clusters/default/namespaces/my-namespace/charts/" + chart.ID)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var b struct {
+			Data *models.Chart `json:"data"`
+		}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&b))
+		if assert.NotNil(t, b.Data) {
+			assert.Equal(t, []models.Label{{Name: "certified"}}, b.Data.Labels)
+			if assert.Len(t, b.Data.ChartVersions, 1) {
+				assert.Equal(t, []models.Label{{Name: "team", Value: "platform"}}, b.Data.ChartVersions[0].Labels)
+			}
+		}
+	})
+}
+
+// tests that a chart synced from an OCI registry (repo.Type == "oci") is
+// served through the exact same code path as one synced from a classic
+// index.yaml repo -- assetsvc doesn't need to know where a chart came from.
+func Test_GetChartInRepo_OCI(t *testing.T) {
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	mock, cleanup := setMockManager(t)
+	defer cleanup()
+
+	chart := models.Chart{
+		Repo:          models.Repo{Name: "my-repo", Type: "oci"},
+		ID:            "my-repo/my-chart",
+		ChartVersions: []models.ChartVersion{{Version: "1.0.0"}},
+	}
+	chartJSON, err := json.Marshal(chart)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	mock.ExpectQuery("SELECT info FROM charts WHERE *").
+		WithArgs("my-namespace", chart.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"info"}).AddRow(chartJSON))
+
+	res, err := http.Get(ts.URL + pathPrefix + "/clusters/default/namespaces/my-namespace/charts/" + chart.ID)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode, "http status code should match")
 }
 
 // tests the GET /{apiVersion}/clusters/default/namespaces/charts/{repo}/{chartName}/versions endpoint
@@ -274,6 +388,38 @@ func Test_ListChartVersions(t *testing.T) {
 			assert.Equal(t, res.StatusCode, tt.wantCode, "http status code should match")
 		})
 	}
+
+	t.Run("labels are surfaced on each returned version", func(t *testing.T) {
+		mock, cleanup := setMockManager(t)
+		defer cleanup()
+
+		chart := models.Chart{
+			Repo: testRepo,
+			ID:   "my-repo/my-chart",
+			ChartVersions: []models.ChartVersion{
+				{Version: "0.1.0", Labels: []models.Label{{Name: "team", Value: "platform"}}},
+			},
+		}
+		chartJSON, err := json.Marshal(chart)
+		assert.NoError(t, err)
+
+		mock.ExpectQuery("SELECT info FROM charts WHERE *").
+			WithArgs("my-namespace", chart.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"info"}).AddRow(chartJSON))
+
+		res, err := http.Get(ts.URL + pathPrefix + "/clusters/default/namespaces/my-namespace/charts/" + chart.ID + "/versions")
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var b struct {
+			Data []models.ChartVersion `json:"data"`
+		}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&b))
+		if assert.Len(t, b.Data, 1) {
+			assert.Equal(t, []models.Label{{Name: "team", Value: "platform"}}, b.Data[0].Labels)
+		}
+	})
 }
 
 // tests the GET /{apiVersion}/clusters/default/namespaces/charts/{repo}/{chartName}/versions/{:version} endpoint
@@ -332,6 +478,38 @@ func Test_GetChartVersion(t *testing.T) {
 			assert.Equal(t, res.StatusCode, tt.wantCode, "http status code should match")
 		})
 	}
+
+	t.Run("labels are surfaced on the returned version", func(t *testing.T) {
+		mock, cleanup := setMockManager(t)
+		defer cleanup()
+
+		chart := models.Chart{
+			Repo: testRepo,
+			ID:   "my-repo/my-chart",
+			ChartVersions: []models.ChartVersion{
+				{Version: "0.1.0", Labels: []models.Label{{Name: "certified"}}},
+			},
+		}
+		chartJSON, err := json.Marshal(chart)
+		assert.NoError(t, err)
+
+		mock.ExpectQuery("SELECT info FROM charts WHERE *").
+			WithArgs("my-namespace", chart.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"info"}).AddRow(chartJSON))
+
+		res, err := http.Get(ts.URL + pathPrefix + "/clusters/default/namespaces/my-namespace/charts/" + chart.ID + "/versions/0.1.0")
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var b struct {
+			Data *models.ChartVersion `json:"data"`
+		}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&b))
+		if assert.NotNil(t, b.Data) {
+			assert.Equal(t, []models.Label{{Name: "certified"}}, b.Data.Labels)
+		}
+	})
 }
 
 // tests both the GET /{apiVersion}/clusters/default/namespaces/{namespace}/assets/{repo}/{chartName}/logo-160x160-fit.png endpoint
@@ -580,3 +758,322 @@ func Test_GetChartSchema(t *testing.T) {
 		})
 	}
 }
+
+// tests the POST /{apiVersion}/clusters/default/namespaces/{namespace}/charts/{repo}/{chartName}/versions/{version}/labels endpoint
+func Test_AddChartVersionLabel(t *testing.T) {
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		label    models.Label
+		err      error
+		wantCode int
+	}{
+		{
+			"attaches a label",
+			models.Label{Name: "certified"},
+			nil,
+			http.StatusCreated,
+		},
+		{
+			"attaches a key=value label",
+			models.Label{Name: "team", Value: "platform"},
+			nil,
+			http.StatusCreated,
+		},
+		{
+			"chart version does not exist",
+			models.Label{Name: "certified"},
+			errors.New("return an error when the chart version does not exist"),
+			http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, cleanup := setMockManager(t)
+			defer cleanup()
+
+			mock.ExpectBegin()
+			if tt.err != nil {
+				mock.ExpectExec("INSERT INTO chart_labels").WillReturnError(tt.err)
+			} else {
+				mock.ExpectExec("INSERT INTO chart_labels").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("UPDATE charts SET info").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			}
+
+			body, err := json.Marshal(tt.label)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+
+			path := ts.URL + pathPrefix + "/clusters/default/namespaces/my-namespace/charts/my-repo/my-chart/versions/0.1.0/labels"
+			req, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+			assert.NoError(t, err)
+			res, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantCode, res.StatusCode, "http status code should match")
+		})
+	}
+}
+
+// tests the GET /{apiVersion}/clusters/default/namespaces/{namespace}/charts/search endpoint
+func Test_SearchCharts(t *testing.T) {
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	mock, cleanup := setMockManager(t)
+	defer cleanup()
+
+	wordpress := models.Chart{ID: "my-repo/wordpress", Name: "wordpress"}
+	wordmove := models.Chart{ID: "my-repo/wordmove", Name: "wordmove"}
+	wordpressJSON, err := json.Marshal(wordpress)
+	assert.NoError(t, err)
+	wordmoveJSON, err := json.Marshal(wordmove)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery("SELECT info, count\\(\\*\\) OVER\\(\\) AS total FROM charts").
+		WillReturnRows(sqlmock.NewRows([]string{"info", "total"}).
+			AddRow(wordpressJSON, 2).
+			AddRow(wordmoveJSON, 2))
+	mock.ExpectQuery("SELECT coalesce\\(repo_name, ''\\), count\\(\\*\\) FROM charts").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("my-repo", 2))
+	mock.ExpectQuery("SELECT coalesce\\(\\(info ->> 'category'\\), ''\\), count\\(\\*\\) FROM charts").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("cms", 2))
+	mock.ExpectQuery("FROM charts, LATERAL jsonb_array_elements.*maintainer").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("Bitnami", 2))
+
+	res, err := http.Get(ts.URL + pathPrefix + "/clusters/default/namespaces/my-namespace/charts/search?q=wordpress&repos=my-repo&page=1&size=10")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode, "http status code should match")
+
+	var b struct {
+		Data *searchResult `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&b))
+	if assert.NotNil(t, b.Data) && assert.Len(t, b.Data.Charts, 2) {
+		// searchCharts preserves the ORDER BY ts_rank_cd row order the mock
+		// returns: the chart name that matches the query exactly first.
+		assert.Equal(t, "wordpress", b.Data.Charts[0].Name)
+		assert.Equal(t, "wordmove", b.Data.Charts[1].Name)
+	}
+	assert.Equal(t, []facetCount{{Value: "my-repo", Count: 2}}, b.Data.Facets.Repos)
+	assert.Equal(t, []facetCount{{Value: "cms", Count: 2}}, b.Data.Facets.Categories)
+	assert.Equal(t, []facetCount{{Value: "Bitnami", Count: 2}}, b.Data.Facets.Maintainers)
+}
+
+// tests the GET /{apiVersion}/clusters/default/namespaces/{namespace}/charts/{repo}/{chartName}/versions/{version}/dependencies endpoint
+func Test_GetChartDependencies(t *testing.T) {
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	t.Run("resolves a semver constraint to the highest matching version", func(t *testing.T) {
+		mock, cleanup := setMockManager(t)
+		defer cleanup()
+
+		chart := models.Chart{
+			ID: "my-repo/my-chart",
+			ChartVersions: []models.ChartVersion{{
+				Version: "1.0.0",
+				Dependencies: []models.Dependency{
+					{Name: "mariadb", Repository: "@my-repo", Version: "^9.0.0"},
+				},
+			}},
+		}
+		dep := models.Chart{
+			ID:            "my-repo/mariadb",
+			ChartVersions: []models.ChartVersion{{Version: "9.1.0"}, {Version: "9.0.0"}, {Version: "8.0.0"}},
+		}
+
+		chartJSON, err := json.Marshal(chart)
+		assert.NoError(t, err)
+		depJSON, err := json.Marshal(dep)
+		assert.NoError(t, err)
+
+		mock.ExpectQuery("SELECT info FROM charts WHERE *").
+			WithArgs("my-namespace", chart.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"info"}).AddRow(chartJSON))
+		mock.ExpectQuery("SELECT info FROM charts WHERE *").
+			WithArgs("my-namespace", dep.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"info"}).AddRow(depJSON))
+
+		res, err := http.Get(ts.URL + pathPrefix + "/clusters/default/namespaces/my-namespace/charts/" + chart.ID + "/versions/1.0.0/dependencies")
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var lock dependencyLock
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&struct {
+			Data *dependencyLock `json:"data"`
+		}{Data: &lock}))
+		assert.Len(t, lock.Dependencies, 1)
+		assert.Equal(t, "9.1.0", lock.Dependencies[0].Version)
+	})
+
+	t.Run("missing dependency is reported per-entry instead of failing the request", func(t *testing.T) {
+		mock, cleanup := setMockManager(t)
+		defer cleanup()
+
+		chart := models.Chart{
+			ID: "my-repo/my-chart",
+			ChartVersions: []models.ChartVersion{{
+				Version:      "1.0.0",
+				Dependencies: []models.Dependency{{Name: "missing", Repository: "@my-repo", Version: "1.0.0"}},
+			}},
+		}
+		chartJSON, err := json.Marshal(chart)
+		assert.NoError(t, err)
+
+		mock.ExpectQuery("SELECT info FROM charts WHERE *").
+			WithArgs("my-namespace", chart.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"info"}).AddRow(chartJSON))
+		mock.ExpectQuery("SELECT info FROM charts WHERE *").
+			WithArgs("my-namespace", "my-repo/missing").
+			WillReturnError(errors.New("not found"))
+
+		res, err := http.Get(ts.URL + pathPrefix + "/clusters/default/namespaces/my-namespace/charts/" + chart.ID + "/versions/1.0.0/dependencies")
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var lock dependencyLock
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&struct {
+			Data *dependencyLock `json:"data"`
+		}{Data: &lock}))
+		assert.Len(t, lock.Dependencies, 1)
+		assert.NotEmpty(t, lock.Dependencies[0].Error)
+	})
+
+	t.Run("a dependency cycle is reported as a conflict", func(t *testing.T) {
+		mock, cleanup := setMockManager(t)
+		defer cleanup()
+
+		chart := models.Chart{
+			ID: "my-repo/my-chart",
+			ChartVersions: []models.ChartVersion{{
+				Version:      "1.0.0",
+				Dependencies: []models.Dependency{{Name: "my-chart", Repository: "@my-repo", Version: "1.0.0"}},
+			}},
+		}
+		chartJSON, err := json.Marshal(chart)
+		assert.NoError(t, err)
+
+		mock.ExpectQuery("SELECT info FROM charts WHERE *").
+			WithArgs("my-namespace", chart.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"info"}).AddRow(chartJSON))
+
+		res, err := http.Get(ts.URL + pathPrefix + "/clusters/default/namespaces/my-namespace/charts/" + chart.ID + "/versions/1.0.0/dependencies")
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+	})
+}
+
+// tests the GET /{apiVersion}/clusters/default/namespaces/{namespace}/repos/{repo}/filter endpoint
+func Test_GetRepoFilter(t *testing.T) {
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		err      error
+		spec     filter.Spec
+		wantCode int
+	}{
+		{
+			"repo has no filter configured",
+			errors.New("return an error when no filter row exists"),
+			filter.Spec{},
+			http.StatusNotFound,
+		},
+		{
+			"repo has a name and annotation filter",
+			nil,
+			filter.Spec{
+				NameGlobs:   []string{"word*"},
+				Annotations: []filter.AnnotationRule{{Key: "certified"}},
+			},
+			http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, cleanup := setMockManager(t)
+			defer cleanup()
+
+			mockQuery := mock.ExpectQuery("SELECT filter FROM repo_filters WHERE *").
+				WithArgs("my-namespace", "my-repo")
+
+			if tt.err != nil {
+				mockQuery.WillReturnError(tt.err)
+			} else {
+				specJSON, err := json.Marshal(tt.spec)
+				if err != nil {
+					t.Fatalf("%+v", err)
+				}
+				mockQuery.WillReturnRows(sqlmock.NewRows([]string{"filter"}).AddRow(specJSON))
+			}
+
+			res, err := http.Get(ts.URL + pathPrefix + "/clusters/default/namespaces/my-namespace/repos/my-repo/filter")
+			assert.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantCode, res.StatusCode, "http status code should match")
+		})
+	}
+}
+
+// tests the DELETE /{apiVersion}/clusters/default/namespaces/{namespace}/charts/{repo}/{chartName}/versions/{version}/labels endpoint
+func Test_RemoveChartVersionLabel(t *testing.T) {
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+	}{
+		{
+			"removes a label",
+			nil,
+			http.StatusOK,
+		},
+		{
+			"chart version does not exist",
+			errors.New("return an error when the chart version does not exist"),
+			http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, cleanup := setMockManager(t)
+			defer cleanup()
+
+			mock.ExpectBegin()
+			if tt.err != nil {
+				mock.ExpectExec("DELETE FROM chart_labels").WillReturnError(tt.err)
+			} else {
+				mock.ExpectExec("DELETE FROM chart_labels").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("UPDATE charts SET info").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			}
+
+			path := ts.URL + pathPrefix + "/clusters/default/namespaces/my-namespace/charts/my-repo/my-chart/versions/0.1.0/labels?name=certified"
+			req, err := http.NewRequest(http.MethodDelete, path, nil)
+			assert.NoError(t, err)
+			res, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantCode, res.StatusCode, "http status code should match")
+		})
+	}
+}
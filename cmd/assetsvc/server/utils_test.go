@@ -0,0 +1,62 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/models"
+)
+
+var testRepo = models.Repo{Namespace: "my-namespace", Name: "my-repo"}
+
+const (
+	testChartReadme = "# my-chart\n\nThis is a test chart."
+	testChartValues = "replicaCount: 1\n"
+	testChartSchema = `{"$schema": "http://json-schema.org/schema#"}`
+)
+
+// setMockManager installs a sqlmock-backed assetManager as the package-level
+// manager for the duration of a test and returns a cleanup function to
+// restore the previous manager and close the mock database.
+func setMockManager(t *testing.T) (sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unable to create sqlmock database: %+v", err)
+	}
+
+	previous := manager
+	manager = &postgresAssetManager{db: db}
+
+	return mock, func() {
+		manager = previous
+		db.Close()
+	}
+}
+
+// iconBytes returns the 8-byte PNG file signature, used to populate
+// models.Chart.RawIcon in tests.
+func iconBytes() []byte {
+	return []byte{0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a}
+}
+
+// stubHealthHTTPClient replaces healthHTTPClient for the duration of a test
+// with one that always reports every backend as reachable, so health
+// checks don't make real network calls.
+func stubHealthHTTPClient(t *testing.T) func() {
+	t.Helper()
+	previous := healthHTTPClient
+	healthHTTPClient = fakePinger{}
+	return func() { healthHTTPClient = previous }
+}
+
+type fakePinger struct{}
+
+func (fakePinger) Get(url string) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
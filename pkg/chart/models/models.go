@@ -0,0 +1,95 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package models defines the structures used to represent charts, chart
+// versions and their associated files as they are persisted by the
+// asset-syncer and served by the assetsvc.
+package models
+
+import "time"
+
+// Maintainer is a chart maintainer as declared in Chart.yaml.
+type Maintainer struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// ChartCategory is an aggregation of charts sharing the same category,
+// along with the number of charts found in that category.
+type ChartCategory struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Label is a user-defined key/value annotation attached to a chart or a
+// specific chart version, e.g. {Name: "certified"} or {Name: "team", Value: "platform"}.
+type Label struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
+
+// Dependency is a single entry of Chart.yaml's `dependencies:` list.
+type Dependency struct {
+	Name         string   `json:"name"`
+	Version      string   `json:"version,omitempty"`
+	Repository   string   `json:"repository,omitempty"`
+	Alias        string   `json:"alias,omitempty"`
+	Condition    string   `json:"condition,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	ImportValues []string `json:"import-values,omitempty"`
+}
+
+// ChartVersion represents a specific packaged version of a chart.
+type ChartVersion struct {
+	Version      string       `json:"version"`
+	AppVersion   string       `json:"app_version"`
+	Created      time.Time    `json:"created"`
+	Digest       string       `json:"digest"`
+	URLs         []string     `json:"urls"`
+	Readme       string       `json:"readme"`
+	Values       string       `json:"values"`
+	Schema       string       `json:"schema"`
+	Labels       []Label      `json:"labels,omitempty"`
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+}
+
+// Repo identifies the chart repository a chart was synced from.
+type Repo struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Type      string `json:"type"`
+}
+
+// Chart represents a chart as stored in the `charts` table and returned by
+// the assetsvc API.
+type Chart struct {
+	ID            string         `json:"ID"`
+	Name          string         `json:"name"`
+	Repo          Repo           `json:"repo"`
+	Description   string         `json:"description"`
+	Home          string         `json:"home"`
+	Keywords      []string       `json:"keywords"`
+	Maintainers   []Maintainer   `json:"maintainers"`
+	Sources       []string       `json:"sources"`
+	Icon          string         `json:"icon"`
+	RawIcon       []byte         `json:"raw_icon,omitempty"`
+	Category      string         `json:"category"`
+	ChartVersions []ChartVersion `json:"chartVersions"`
+	Labels        []Label        `json:"labels,omitempty"`
+	// Annotations holds the annotations declared in Chart.yaml, used by the
+	// asset-syncer's filter flags to admit or skip a chart version at sync
+	// time.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ChartFiles holds the auxiliary files extracted from a chart version that
+// aren't part of the chart's index entry (README, values, schema).
+type ChartFiles struct {
+	ID     string `json:"ID"`
+	Repo   Repo   `json:"repo"`
+	Digest string `json:"digest"`
+	Readme string `json:"readme"`
+	Values string `json:"values"`
+	Schema string `json:"schema"`
+}
@@ -0,0 +1,268 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package oci implements just enough of the OCI Distribution Spec to serve
+// Helm charts pushed to an OCI registry (`helm push`) the same way assetsvc
+// serves charts synced from a classic index.yaml repo.
+package oci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/vmware-tanzu/kubeapps/pkg/chart/models"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	chartManifestMediaType = "application/vnd.cncf.helm.chart.v1+json"
+	chartContentMediaType  = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+// Auth is the credential used to authenticate against an OCI registry,
+// sourced from a ~/.docker/config.json-style secret stored on the repo CR.
+type Auth struct {
+	Username string
+	Password string
+}
+
+// DockerConfigJSON is the subset of ~/.docker/config.json needed to resolve
+// a registry's credentials.
+type DockerConfigJSON struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+}
+
+// AuthForRegistry decodes the basic-auth credential configured for the given
+// registry host in a docker config secret, if any.
+func (c DockerConfigJSON) AuthForRegistry(registry string) (Auth, bool) {
+	entry, ok := c.Auths[registry]
+	if !ok {
+		return Auth{}, false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+	if err != nil {
+		return Auth{}, false
+	}
+	user, pass, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return Auth{}, false
+	}
+	return Auth{Username: user, Password: pass}, true
+}
+
+// Client talks to an OCI Distribution Spec registry to discover and fetch
+// Helm charts.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	auth       Auth
+}
+
+// NewClient creates a Client for the given registry host (e.g.
+// "registry-1.docker.io"), optionally authenticating with auth. registry is
+// assumed to be reachable over HTTPS unless it already carries an explicit
+// "http://" or "https://" scheme (e.g. a local insecure registry used in
+// tests).
+func NewClient(registry string, auth Auth) *Client {
+	baseURL := registry
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	return &Client{httpClient: http.DefaultClient, baseURL: baseURL, auth: auth}
+}
+
+// ListTags lists every tag pushed for the given repository path (e.g.
+// "bitnami/wordpress"), as per GET /v2/{name}/tags/list.
+func (c *Client) ListTags(repoName string) ([]string, error) {
+	url := fmt.Sprintf("%s/v2/%s/tags/list", c.baseURL, repoName)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setAuth(req)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status listing tags for %s: %s", repoName, res.Status)
+	}
+
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Tags, nil
+}
+
+// manifest is the OCI image manifest for a Helm chart.
+type manifest struct {
+	Config struct {
+		MediaType string `json:"mediaType"`
+	} `json:"config"`
+	Layers []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"layers"`
+}
+
+// FetchChart pulls the chart manifest for repoName:tag and extracts
+// Chart.yaml, values.yaml, values.schema.json and README.md from its
+// content layer, returning them as a models.Chart/models.ChartFiles pair.
+func (c *Client) FetchChart(repoName, tag string) (models.Chart, models.ChartFiles, error) {
+	var chart models.Chart
+	var files models.ChartFiles
+
+	m, err := c.getManifest(repoName, tag)
+	if err != nil {
+		return chart, files, err
+	}
+	if m.Config.MediaType != chartManifestMediaType {
+		return chart, files, fmt.Errorf("%s:%s is not a Helm chart manifest (got config media type %q)", repoName, tag, m.Config.MediaType)
+	}
+
+	var contentDigest string
+	for _, layer := range m.Layers {
+		if layer.MediaType == chartContentMediaType {
+			contentDigest = layer.Digest
+			break
+		}
+	}
+	if contentDigest == "" {
+		return chart, files, fmt.Errorf("%s:%s has no chart content layer", repoName, tag)
+	}
+
+	blob, err := c.getBlob(repoName, contentDigest)
+	if err != nil {
+		return chart, files, err
+	}
+	defer blob.Close()
+
+	chart, files, err = extractChartContent(blob)
+	if err != nil {
+		return chart, files, err
+	}
+	chart.ChartVersions = []models.ChartVersion{{Version: tag, Digest: contentDigest}}
+	files.Digest = contentDigest
+	return chart, files, nil
+}
+
+func (c *Client) getManifest(repoName, tag string) (manifest, error) {
+	var m manifest
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", c.baseURL, repoName, tag)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return m, err
+	}
+	req.Header.Set("Accept", "application/vnd.oci.image.manifest.v1+json")
+	c.setAuth(req)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return m, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return m, fmt.Errorf("unexpected status fetching manifest %s:%s: %s", repoName, tag, res.Status)
+	}
+	return m, json.NewDecoder(res.Body).Decode(&m)
+}
+
+func (c *Client) getBlob(repoName, digest string) (io.ReadCloser, error) {
+	url := fmt.Sprintf("%s/v2/%s/blobs/%s", c.baseURL, repoName, digest)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setAuth(req)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected status fetching blob %s: %s", digest, res.Status)
+	}
+	return res.Body, nil
+}
+
+func (c *Client) setAuth(req *http.Request) {
+	if c.auth.Username != "" {
+		req.SetBasicAuth(c.auth.Username, c.auth.Password)
+	}
+}
+
+// extractChartContent reads a gzipped tarball as produced by `helm push`
+// (content media type application/vnd.cncf.helm.chart.content.v1.tar+gzip)
+// and pulls out the fields assetsvc needs to serve the chart.
+func extractChartContent(r io.Reader) (models.Chart, models.ChartFiles, error) {
+	var chart models.Chart
+	var files models.ChartFiles
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return chart, files, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return chart, files, err
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return chart, files, err
+		}
+
+		switch path.Base(hdr.Name) {
+		case "Chart.yaml":
+			var meta struct {
+				Name        string            `yaml:"name"`
+				Description string            `yaml:"description"`
+				Home        string            `yaml:"home"`
+				Keywords    []string          `yaml:"keywords"`
+				Sources     []string          `yaml:"sources"`
+				Icon        string            `yaml:"icon"`
+				Annotations map[string]string `yaml:"annotations"`
+			}
+			if err := yaml.Unmarshal(content, &meta); err != nil {
+				return chart, files, fmt.Errorf("invalid Chart.yaml: %w", err)
+			}
+			chart.Name = meta.Name
+			chart.Description = meta.Description
+			chart.Home = meta.Home
+			chart.Keywords = meta.Keywords
+			chart.Sources = meta.Sources
+			chart.Icon = meta.Icon
+			chart.Annotations = meta.Annotations
+		case "values.yaml":
+			files.Values = string(content)
+		case "values.schema.json":
+			files.Schema = string(content)
+		case "README.md":
+			files.Readme = string(content)
+		}
+	}
+
+	return chart, files, nil
+}
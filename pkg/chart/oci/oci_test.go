@@ -0,0 +1,99 @@
+// Copyright 2021-2022 the Kubeapps contributors.
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func chartContentLayer(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	files := map[string]string{
+		"mychart/Chart.yaml":  "name: mychart\ndescription: a test chart\n",
+		"mychart/values.yaml": "replicaCount: 1\n",
+		"mychart/README.md":   "# mychart",
+	}
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Size: int64(len(content)), Mode: 0600}
+		assert.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func Test_ListTags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/bitnami/wordpress/tags/list", r.URL.Path)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"1.0.0", "1.1.0"}})
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, Auth{})
+	c.httpClient = ts.Client()
+	tags, err := c.ListTags("bitnami/wordpress")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.0.0", "1.1.0"}, tags)
+}
+
+func Test_FetchChart(t *testing.T) {
+	content := chartContentLayer(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/bitnami/wordpress/manifests/1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(manifest{
+			Config: struct {
+				MediaType string `json:"mediaType"`
+			}{MediaType: chartManifestMediaType},
+			Layers: []struct {
+				MediaType string `json:"mediaType"`
+				Digest    string `json:"digest"`
+			}{{MediaType: chartContentMediaType, Digest: "sha256:abc"}},
+		})
+	})
+	mux.HandleFunc("/v2/bitnami/wordpress/blobs/sha256:abc", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(content)
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	c := NewClient(ts.URL, Auth{})
+	c.httpClient = ts.Client()
+
+	chart, files, err := c.FetchChart("bitnami/wordpress", "1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "mychart", chart.Name)
+	assert.Equal(t, "a test chart", chart.Description)
+	assert.Equal(t, "replicaCount: 1\n", files.Values)
+	assert.Equal(t, "# mychart", files.Readme)
+	assert.Equal(t, "sha256:abc", files.Digest)
+}
+
+func Test_DockerConfigJSON_AuthForRegistry(t *testing.T) {
+	cfg := DockerConfigJSON{}
+	err := json.Unmarshal([]byte(`{"auths":{"registry-1.docker.io":{"auth":"dXNlcjpwYXNz"}}}`), &cfg)
+	assert.NoError(t, err)
+
+	auth, ok := cfg.AuthForRegistry("registry-1.docker.io")
+	assert.True(t, ok)
+	assert.Equal(t, Auth{Username: "user", Password: "pass"}, auth)
+
+	_, ok = cfg.AuthForRegistry("unknown.example.com")
+	assert.False(t, ok)
+}